@@ -0,0 +1,30 @@
+package config
+
+// Icmp holds the configuration for the icmp protocol analyzer, as read
+// from the `icmp` section of the protocols config.
+type Icmp struct {
+	SendRequest        *bool
+	SendResponse       *bool
+	TransactionTimeout *int
+
+	// LegacyFields, when true, makes the icmp protocol also publish the
+	// flat client_ip/bytes_in/bytes_out/responsetime fields used before
+	// the move to the Elastic Common Schema.
+	LegacyFields *bool
+
+	Prober         IcmpProber
+	FloodDetection IcmpFloodDetection
+}
+
+// Protocols groups the configuration of each protocol analyzer.
+type Protocols struct {
+	Icmp Icmp
+}
+
+// Config is the root packetbeat configuration.
+type Config struct {
+	Protocols Protocols
+}
+
+// ConfigSingleton is the parsed configuration, populated at startup.
+var ConfigSingleton Config
@@ -0,0 +1,10 @@
+package config
+
+// IcmpFloodDetection configures the per-tuple rate limiting and flood
+// detection layer.
+type IcmpFloodDetection struct {
+	Enabled          *bool
+	PacketsPerSecond *float64
+	Burst            *float64
+	WindowSeconds    *int
+}
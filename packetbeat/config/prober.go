@@ -0,0 +1,17 @@
+package config
+
+// IcmpProberTarget is a single host the active prober sends periodic echo
+// requests to.
+type IcmpProberTarget struct {
+	Host  string
+	Label string
+}
+
+// IcmpProber configures the active ICMP probing subsystem.
+type IcmpProber struct {
+	Enabled    *bool
+	Targets    []IcmpProberTarget
+	Interval   *int
+	Timeout    *int
+	PacketSize *int
+}
@@ -0,0 +1,83 @@
+package icmp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+)
+
+// communityIDVersion is prefixed to every computed hash, per the Community
+// ID Flow Hashing spec (https://github.com/corelight/community-id-spec).
+const communityIDVersion = "1"
+
+type icmpTypeCode struct {
+	Type, Code uint8
+}
+
+// icmpV4Equivalents and icmpV6Equivalents map a "reply" (type, code) pair to
+// its "request" equivalent, so that both sides of a conversation hash to
+// the same Community ID.
+var icmpV4Equivalents = map[icmpTypeCode]icmpTypeCode{
+	{icmpV4EchoReply, 0}: {icmpV4EchoRequest, 0},
+	{14, 0}:              {13, 0}, // Timestamp Reply -> Timestamp Request
+	{16, 0}:              {15, 0}, // Information Reply -> Information Request
+	{18, 0}:              {17, 0}, // Address Mask Reply -> Address Mask Request
+}
+
+var icmpV6Equivalents = map[icmpTypeCode]icmpTypeCode{
+	{icmpV6EchoReply, 0}: {icmpV6EchoRequest, 0},
+	{134, 0}:             {133, 0}, // Router Advertisement -> Router Solicitation
+	{136, 0}:             {135, 0}, // Neighbor Advertisement -> Neighbor Solicitation
+}
+
+// communityIDICMP computes the Community ID for an ICMP or ICMPv6 message
+// that, as observed on the wire, travelled from srcIp to dstIp. Reply-class
+// messages are canonicalized to their request equivalent (with source and
+// destination swapped) so that a request and its reply produce the same
+// hash.
+func communityIDICMP(version uint8, srcIp, dstIp net.IP, typ, code uint8) string {
+	proto := byte(1)
+	equivalents := icmpV4Equivalents
+	if version == 6 {
+		proto = 58
+		equivalents = icmpV6Equivalents
+	}
+
+	if req, ok := equivalents[icmpTypeCode{typ, code}]; ok {
+		typ, code = req.Type, req.Code
+		srcIp, dstIp = dstIp, srcIp
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, uint16(0)) // seed
+	if version == 4 {
+		buf.Write(srcIp.To4())
+		buf.Write(dstIp.To4())
+	} else {
+		buf.Write(srcIp.To16())
+		buf.Write(dstIp.To16())
+	}
+	buf.WriteByte(proto)
+	buf.WriteByte(0) // padding, mirrors the zero "flow label" byte used for TCP/UDP
+	binary.Write(buf, binary.BigEndian, uint16(typ)<<8|uint16(code))
+
+	sum := sha1.Sum(buf.Bytes())
+	return communityIDVersion + ":" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// communityID computes the Community ID for a transaction, using whichever
+// side of the conversation was actually observed.
+func communityID(trans *icmpTransaction) string {
+	switch {
+	case trans.Request != nil:
+		return communityIDICMP(trans.Tuple.IcmpVersion, trans.Tuple.SrcIp, trans.Tuple.DstIp,
+			trans.Request.Type, trans.Request.Code)
+	case trans.Response != nil:
+		return communityIDICMP(trans.Tuple.IcmpVersion, trans.Tuple.DstIp, trans.Tuple.SrcIp,
+			trans.Response.Type, trans.Response.Code)
+	default:
+		return ""
+	}
+}
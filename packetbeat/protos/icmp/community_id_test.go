@@ -0,0 +1,86 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+)
+
+// Expected values below were computed independently (Python, sha1+base64
+// over the exact byte layout documented in communityIDICMP) so this is a
+// regression test against that documented layout, not an externally
+// sourced spec vector.
+
+func TestCommunityIDICMPv4EchoRequest(t *testing.T) {
+	src := net.ParseIP("1.2.3.4")
+	dst := net.ParseIP("5.6.7.8")
+
+	got := communityIDICMP(4, src, dst, icmpV4EchoRequest, 0)
+	want := "1:QaV25APiM6w7qxT+3H4+T4qkC7Y="
+	if got != want {
+		t.Errorf("communityIDICMP() = %q, want %q", got, want)
+	}
+}
+
+func TestCommunityIDICMPv4EchoReplyMatchesRequest(t *testing.T) {
+	src := net.ParseIP("1.2.3.4")
+	dst := net.ParseIP("5.6.7.8")
+
+	request := communityIDICMP(4, src, dst, icmpV4EchoRequest, 0)
+	// The reply is observed travelling dst->src.
+	reply := communityIDICMP(4, dst, src, icmpV4EchoReply, 0)
+
+	if request != reply {
+		t.Errorf("echo request/reply community IDs differ: request=%q reply=%q", request, reply)
+	}
+}
+
+func TestCommunityIDICMPv6EchoRequestReplyMatch(t *testing.T) {
+	src := net.ParseIP("2001:db8::1")
+	dst := net.ParseIP("2001:db8::2")
+
+	request := communityIDICMP(6, src, dst, icmpV6EchoRequest, 0)
+	want := "1:F7hWQSje9Y1xAuHCvyFIcgP6t10="
+	if request != want {
+		t.Errorf("communityIDICMP() = %q, want %q", request, want)
+	}
+
+	reply := communityIDICMP(6, dst, src, icmpV6EchoReply, 0)
+	if request != reply {
+		t.Errorf("v6 echo request/reply community IDs differ: request=%q reply=%q", request, reply)
+	}
+}
+
+func TestCommunityIDICMPErrorDoesNotMatchEcho(t *testing.T) {
+	src := net.ParseIP("1.2.3.4")
+	dst := net.ParseIP("5.6.7.8")
+
+	echo := communityIDICMP(4, src, dst, icmpV4EchoRequest, 0)
+	unreachable := communityIDICMP(4, src, dst, 3, 1) // Destination Unreachable, no request/reply pairing
+
+	if echo == unreachable {
+		t.Errorf("Destination Unreachable unexpectedly hashed the same as an echo request: %q", echo)
+	}
+}
+
+func TestCommunityIDTransactionUsesWhicheverSideWasObserved(t *testing.T) {
+	src := net.ParseIP("1.2.3.4")
+	dst := net.ParseIP("5.6.7.8")
+
+	withRequest := &icmpTransaction{
+		Tuple:   icmpTuple{IcmpVersion: 4, SrcIp: src, DstIp: dst},
+		Request: &icmpMessage{Type: icmpV4EchoRequest, Code: 0},
+	}
+	withResponseOnly := &icmpTransaction{
+		Tuple:    icmpTuple{IcmpVersion: 4, SrcIp: src, DstIp: dst},
+		Response: &icmpMessage{Type: icmpV4EchoReply, Code: 0},
+	}
+
+	if communityID(withRequest) != communityID(withResponseOnly) {
+		t.Errorf("orphaned response should hash the same as its matching request: request=%q response-only=%q",
+			communityID(withRequest), communityID(withResponseOnly))
+	}
+
+	if communityID(&icmpTransaction{}) != "" {
+		t.Errorf("communityID() of a transaction with neither request nor response should be empty")
+	}
+}
@@ -0,0 +1,169 @@
+package icmp
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/elastic/libbeat/common"
+
+	"github.com/elastic/packetbeat/protos"
+)
+
+// floodTuple identifies the (source, destination, ICMP type) a flood is
+// tracked against. Unlike icmpTuple, it deliberately ignores id/seq so
+// that every packet in a flood lands on the same bucket.
+type floodTuple struct {
+	SrcIp, DstIp net.IP
+	Type         uint8
+}
+
+type hashableFloodTuple [33]byte
+
+func (t *floodTuple) Hashable() hashableFloodTuple {
+	var h hashableFloodTuple
+	copy(h[0:16], t.SrcIp.To16())
+	copy(h[16:32], t.DstIp.To16())
+	h[32] = t.Type
+	return h
+}
+
+// floodState is the token-bucket + in-progress aggregate kept per
+// floodTuple.
+type floodState struct {
+	Tuple floodTuple
+
+	tokens     float64
+	lastRefill time.Time
+
+	aggregating bool
+	windowStart time.Time
+	lastSeen    time.Time
+	packets     int
+	uniqueSeqs  map[uint16]struct{}
+}
+
+// floodDetector rate-limits ICMP transaction creation per (SrcIp, DstIp,
+// Type) using a token bucket, and replaces the per-packet transactions of
+// a flood with a single aggregated alert every window.
+type floodDetector struct {
+	icmp *Icmp
+
+	pps    float64
+	burst  float64
+	window time.Duration
+
+	cache *common.Cache
+}
+
+func newFloodDetector(icmp *Icmp, pps, burst float64, window time.Duration) *floodDetector {
+	fd := &floodDetector{icmp: icmp, pps: pps, burst: burst, window: window}
+
+	fd.cache = common.NewCacheWithRemovalListener(
+		window,
+		protos.DefaultTransactionHashSize,
+		func(k common.Key, v common.Value) {
+			fd.flush(v.(*floodState))
+		})
+	fd.cache.StartJanitor(window)
+
+	return fd
+}
+
+// observe records one packet against its (SrcIp, DstIp, Type) bucket and
+// reports whether it should be absorbed into flood aggregation rather than
+// processed as a regular transaction.
+func (fd *floodDetector) observe(src, dst net.IP, typ uint8, seq uint16, ts time.Time) bool {
+	tuple := floodTuple{SrcIp: src, DstIp: dst, Type: typ}
+	key := tuple.Hashable()
+
+	state, _ := fd.cache.Get(key).(*floodState)
+	if state == nil {
+		state = &floodState{Tuple: tuple, tokens: fd.burst, lastRefill: ts}
+		fd.cache.Put(key, state)
+	}
+
+	if elapsed := ts.Sub(state.lastRefill).Seconds(); elapsed > 0 {
+		state.tokens = math.Min(fd.burst, state.tokens+elapsed*fd.pps)
+		state.lastRefill = ts
+	}
+
+	if !state.aggregating {
+		if state.tokens >= 1 {
+			state.tokens--
+			return false
+		}
+
+		// Threshold exceeded: start aggregating instead of letting every
+		// packet create its own transaction.
+		state.aggregating = true
+		state.windowStart = ts
+		state.packets = 0
+		state.uniqueSeqs = make(map[uint16]struct{})
+	}
+
+	state.packets++
+	state.uniqueSeqs[seq] = struct{}{}
+	state.lastSeen = ts
+
+	if ts.Sub(state.windowStart) >= fd.window {
+		fd.icmp.publishFloodEvent(state)
+		// Start a fresh window but keep aggregating: a sustained flood is
+		// still over threshold, and dropping back to the token bucket here
+		// would let a burst of packets through as ordinary per-packet
+		// transactions every window, defeating the point of aggregating in
+		// the first place. The token bucket is not consulted while a bucket
+		// is aggregating; aggregation ends only when the bucket goes idle
+		// and is evicted from the cache.
+		state.windowStart = ts
+		state.packets = 0
+		state.uniqueSeqs = make(map[uint16]struct{})
+	}
+
+	return true
+}
+
+// flush publishes whatever was accumulated for a bucket that went idle
+// long enough to be evicted from the cache mid-aggregation.
+func (fd *floodDetector) flush(state *floodState) {
+	if state.aggregating && state.packets > 0 {
+		fd.icmp.publishFloodEvent(state)
+	}
+}
+
+// publishFloodEvent emits a single alert summarizing a flood window,
+// instead of the one-transaction-per-packet events normal traffic gets.
+func (icmp *Icmp) publishFloodEvent(state *floodState) {
+	if icmp.results == nil {
+		return
+	}
+
+	event := common.MapStr{
+		"@timestamp": common.Time(state.windowStart),
+		"type":       "icmp",
+		"count":      1,
+	}
+	event["event"] = common.MapStr{
+		"dataset":  "icmp",
+		"kind":     "alert",
+		"category": "network_traffic",
+		"action":   "icmp_flood",
+		"start":    common.Time(state.windowStart),
+		"end":      common.Time(state.lastSeen),
+	}
+	event["network"] = common.MapStr{
+		"direction": icmp.networkDirection(state.Tuple.SrcIp, state.Tuple.DstIp),
+	}
+	event["source"] = common.MapStr{"ip": state.Tuple.SrcIp}
+	event["destination"] = common.MapStr{"ip": state.Tuple.DstIp}
+	event["icmp"] = common.MapStr{
+		"type": state.Tuple.Type,
+		"flood": common.MapStr{
+			"packets":    state.packets,
+			"unique_seq": len(state.uniqueSeqs),
+			"duration":   state.lastSeen.Sub(state.windowStart).Nanoseconds(),
+		},
+	}
+
+	icmp.results.PublishEvent(event)
+}
@@ -0,0 +1,138 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestFloodDetector(pps, burst float64, window time.Duration) *floodDetector {
+	return newFloodDetector(&Icmp{}, pps, burst, window)
+}
+
+func TestFloodDetectorObserveUnderThresholdNotAbsorbed(t *testing.T) {
+	fd := newTestFloodDetector(10, 5, time.Second)
+	src, dst := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	ts := time.Unix(0, 0)
+
+	for i := 0; i < 5; i++ {
+		if absorbed := fd.observe(src, dst, icmpV4EchoRequest, uint16(i), ts); absorbed {
+			t.Fatalf("packet %d absorbed while still under the burst allowance", i)
+		}
+	}
+}
+
+func TestFloodDetectorObserveOverThresholdAggregates(t *testing.T) {
+	fd := newTestFloodDetector(10, 2, time.Second)
+	src, dst := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	ts := time.Unix(0, 0)
+
+	// Burst of 2 is spent immediately (tokens don't refill within the same instant).
+	fd.observe(src, dst, icmpV4EchoRequest, 1, ts)
+	fd.observe(src, dst, icmpV4EchoRequest, 2, ts)
+
+	if absorbed := fd.observe(src, dst, icmpV4EchoRequest, 3, ts); !absorbed {
+		t.Fatal("packet exceeding the token bucket was not absorbed into aggregation")
+	}
+
+	key := (&floodTuple{SrcIp: src, DstIp: dst, Type: icmpV4EchoRequest}).Hashable()
+	state, _ := fd.cache.Get(key).(*floodState)
+	if state == nil || !state.aggregating {
+		t.Fatal("expected bucket to be aggregating after exceeding its token bucket")
+	}
+	if state.packets != 1 {
+		t.Errorf("packets = %d, want 1", state.packets)
+	}
+}
+
+func TestFloodDetectorWindowExpiryPublishesAndStartsNewWindow(t *testing.T) {
+	fd := newTestFloodDetector(10, 1, time.Second)
+	src, dst := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	start := time.Unix(0, 0)
+
+	fd.observe(src, dst, icmpV4EchoRequest, 1, start)                        // spends the single token
+	fd.observe(src, dst, icmpV4EchoRequest, 2, start.Add(10*time.Millisecond)) // starts aggregating
+
+	// This packet lands after the window has elapsed, so it should trigger
+	// publishFloodEvent and start a new aggregation window.
+	fd.observe(src, dst, icmpV4EchoRequest, 3, start.Add(2*time.Second))
+
+	key := (&floodTuple{SrcIp: src, DstIp: dst, Type: icmpV4EchoRequest}).Hashable()
+	state, _ := fd.cache.Get(key).(*floodState)
+	if state == nil {
+		t.Fatal("bucket disappeared after window expiry")
+	}
+	if !state.aggregating {
+		t.Error("bucket stopped aggregating after a window was published, even though the source is still over threshold")
+	}
+	if state.packets != 0 {
+		t.Errorf("packets = %d after window reset, want 0", state.packets)
+	}
+}
+
+func TestFloodDetectorSustainedFloodStaysAggregatedAcrossWindows(t *testing.T) {
+	fd := newTestFloodDetector(1, 1, time.Second)
+	src, dst := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	start := time.Unix(0, 0)
+
+	fd.observe(src, dst, icmpV4EchoRequest, 1, start) // spends the single token
+	fd.observe(src, dst, icmpV4EchoRequest, 2, start)  // tokens exhausted: starts aggregating
+
+	// Drive the bucket across several window boundaries. A continuous
+	// flood must stay aggregated the whole time: if a window flush
+	// handed the bucket back to the token bucket (the bug this test guards
+	// against), some of these packets would stop being absorbed as the
+	// tokens refill between them, and would instead create
+	// their own per-packet transactions again, defeating the point of
+	// aggregation during a sustained flood.
+	for i := uint16(3); i < 13; i++ {
+		ts := start.Add(time.Duration(i) * 300 * time.Millisecond)
+		if absorbed := fd.observe(src, dst, icmpV4EchoRequest, i, ts); !absorbed {
+			t.Fatalf("packet %d was not absorbed during a sustained flood spanning multiple windows", i)
+		}
+	}
+
+	key := (&floodTuple{SrcIp: src, DstIp: dst, Type: icmpV4EchoRequest}).Hashable()
+	state, _ := fd.cache.Get(key).(*floodState)
+	if state == nil || !state.aggregating {
+		t.Fatal("bucket stopped aggregating during a sustained flood")
+	}
+}
+
+func TestFloodDetectorFlushIdleAggregatingBucketWithoutResultsDoesNotPanic(t *testing.T) {
+	fd := newTestFloodDetector(10, 1, time.Second)
+	state := &floodState{
+		Tuple:       floodTuple{SrcIp: net.ParseIP("10.0.0.1"), DstIp: net.ParseIP("10.0.0.2"), Type: icmpV4EchoRequest},
+		aggregating: true,
+		packets:     3,
+		uniqueSeqs:  map[uint16]struct{}{1: {}, 2: {}, 3: {}},
+		windowStart: time.Unix(0, 0),
+		lastSeen:    time.Unix(0, 0).Add(500 * time.Millisecond),
+	}
+
+	// icmp.results is nil, so publishFloodEvent must be a no-op rather than
+	// panicking on eviction of an idle bucket.
+	fd.flush(state)
+}
+
+func TestFloodDetectorFlushNonAggregatingBucketDoesNotPanic(t *testing.T) {
+	fd := newTestFloodDetector(10, 1, time.Second)
+	state := &floodState{
+		Tuple:       floodTuple{SrcIp: net.ParseIP("10.0.0.1"), DstIp: net.ParseIP("10.0.0.2"), Type: icmpV4EchoRequest},
+		aggregating: false,
+	}
+
+	fd.flush(state)
+}
+
+func TestFloodDetectorSeparateBucketsPerTuple(t *testing.T) {
+	fd := newTestFloodDetector(10, 1, time.Second)
+	ts := time.Unix(0, 0)
+
+	a := fd.observe(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), icmpV4EchoRequest, 1, ts)
+	b := fd.observe(net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.4"), icmpV4EchoRequest, 1, ts)
+
+	if a || b {
+		t.Fatal("independent tuples should each get their own token bucket allowance")
+	}
+}
@@ -0,0 +1,16 @@
+package icmp
+
+import "github.com/elastic/libbeat/common"
+
+// FlowIdLookup is implemented by the flows subsystem. It lets Icmp join an
+// ICMP error back to the TCP/UDP flow that provoked it, without the icmp
+// package needing to depend on the flows package directly.
+type FlowIdLookup interface {
+	FlowID(tuple *common.IpPortTuple, proto uint8) (flowId string, found bool)
+}
+
+// SetFlows wires the flows subsystem into Icmp so that original datagrams
+// embedded in ICMP errors can be resolved to a flow.id.
+func (icmp *Icmp) SetFlows(flows FlowIdLookup) {
+	icmp.flows = flows
+}
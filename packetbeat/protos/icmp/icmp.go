@@ -25,6 +25,7 @@ type ICMPv6Processor interface {
 type Icmp struct {
 	sendRequest  bool
 	sendResponse bool
+	legacyFields bool
 
 	localIps []net.IP
 
@@ -34,6 +35,20 @@ type Icmp struct {
 	transactionTimeout time.Duration
 
 	results publisher.Client
+
+	// prober, when configured, sends active echo requests in addition to
+	// processing passively captured ICMP traffic.
+	prober *Prober
+
+	// flows, when set, lets ICMP errors be joined back to the TCP/UDP flow
+	// that provoked them.
+	flows FlowIdLookup
+
+	floodEnabled bool
+	floodPPS     float64
+	floodBurst   float64
+	floodWindow  time.Duration
+	flood        *floodDetector
 }
 
 const (
@@ -81,6 +96,21 @@ func NewIcmp(testMode bool, results publisher.Client) (*Icmp, error) {
 
 	icmp.results = results
 
+	if icmp.floodEnabled {
+		icmp.flood = newFloodDetector(icmp, icmp.floodPPS, icmp.floodBurst, icmp.floodWindow)
+	}
+
+	if !testMode && config.ConfigSingleton.Protocols.Icmp.Prober.Enabled != nil &&
+		*config.ConfigSingleton.Protocols.Icmp.Prober.Enabled {
+		icmp.prober, err = NewProber(icmp, config.ConfigSingleton.Protocols.Icmp.Prober)
+		if err != nil {
+			return nil, err
+		}
+		if err := icmp.prober.Start(); err != nil {
+			return nil, err
+		}
+	}
+
 	return icmp, nil
 }
 
@@ -88,6 +118,10 @@ func (icmp *Icmp) initDefaults() {
 	icmp.sendRequest = false
 	icmp.sendResponse = false
 	icmp.transactionTimeout = protos.DefaultTransactionExpiration
+	icmp.floodEnabled = false
+	icmp.floodPPS = 100
+	icmp.floodBurst = 200
+	icmp.floodWindow = 10 * time.Second
 }
 
 func (icmp *Icmp) setFromConfig(config config.Icmp) (err error) {
@@ -100,6 +134,21 @@ func (icmp *Icmp) setFromConfig(config config.Icmp) (err error) {
 	if config.TransactionTimeout != nil && *config.TransactionTimeout > 0 {
 		icmp.transactionTimeout = time.Duration(*config.TransactionTimeout) * time.Second
 	}
+	if config.LegacyFields != nil {
+		icmp.legacyFields = *config.LegacyFields
+	}
+	if config.FloodDetection.Enabled != nil {
+		icmp.floodEnabled = *config.FloodDetection.Enabled
+	}
+	if config.FloodDetection.PacketsPerSecond != nil && *config.FloodDetection.PacketsPerSecond > 0 {
+		icmp.floodPPS = *config.FloodDetection.PacketsPerSecond
+	}
+	if config.FloodDetection.Burst != nil && *config.FloodDetection.Burst > 0 {
+		icmp.floodBurst = *config.FloodDetection.Burst
+	}
+	if config.FloodDetection.WindowSeconds != nil && *config.FloodDetection.WindowSeconds > 0 {
+		icmp.floodWindow = time.Duration(*config.FloodDetection.WindowSeconds) * time.Second
+	}
 
 	return nil
 }
@@ -108,6 +157,11 @@ func (icmp *Icmp) ProcessICMPv4(icmp4 *layers.ICMPv4, pkt *protos.Packet) {
 	typ := uint8(icmp4.TypeCode >> 8)
 	code := uint8(icmp4.TypeCode)
 	id, seq := extractTrackingData(4, typ, &icmp4.BaseLayer)
+
+	if icmp.flood != nil && icmp.flood.observe(pkt.Tuple.Src_ip, pkt.Tuple.Dst_ip, typ, seq, pkt.Ts) {
+		return
+	}
+
 	tuple := icmpTuple{
 		IcmpVersion: 4,
 		SrcIp:       pkt.Tuple.Src_ip,
@@ -121,13 +175,37 @@ func (icmp *Icmp) ProcessICMPv4(icmp4 *layers.ICMPv4, pkt *protos.Packet) {
 		Code:   code,
 		Length: len(icmp4.BaseLayer.Payload),
 	}
+	if isErrorTypeV4(typ) {
+		msg.OriginalDatagram, _ = parseOriginalDatagramV4(icmp4.BaseLayer.Payload)
+	}
+	if icmp.sendRequest || icmp.sendResponse {
+		msg.Payload = icmp4.BaseLayer.Payload
+	}
 	icmp.processMessage(&tuple, &msg)
 }
 
 func (icmp *Icmp) ProcessICMPv6(icmp6 *layers.ICMPv6, pkt *protos.Packet) {
 	typ := uint8(icmp6.TypeCode >> 8)
 	code := uint8(icmp6.TypeCode)
+
+	// Neighbor Discovery and Multicast Listener Discovery are not
+	// request/response conversations, so they bypass the transactions
+	// cache entirely and are published as standalone events.
+	if isNDPType(typ) {
+		icmp.publishNDP(pkt, typ, code, icmp6.BaseLayer.Payload)
+		return
+	}
+	if isMLDType(typ) {
+		icmp.publishMLD(pkt, typ, code, icmp6.BaseLayer.Payload)
+		return
+	}
+
 	id, seq := extractTrackingData(6, typ, &icmp6.BaseLayer)
+
+	if icmp.flood != nil && icmp.flood.observe(pkt.Tuple.Src_ip, pkt.Tuple.Dst_ip, typ, seq, pkt.Ts) {
+		return
+	}
+
 	tuple := icmpTuple{
 		IcmpVersion: 6,
 		SrcIp:       pkt.Tuple.Src_ip,
@@ -141,10 +219,27 @@ func (icmp *Icmp) ProcessICMPv6(icmp6 *layers.ICMPv6, pkt *protos.Packet) {
 		Code:   code,
 		Length: len(icmp6.BaseLayer.Payload),
 	}
+	if isErrorTypeV6(typ) {
+		msg.OriginalDatagram, _ = parseOriginalDatagramV6(icmp6.BaseLayer.Payload)
+	}
+	if icmp.sendRequest || icmp.sendResponse {
+		msg.Payload = icmp6.BaseLayer.Payload
+	}
 	icmp.processMessage(&tuple, &msg)
 }
 
 func (icmp *Icmp) processMessage(tuple *icmpTuple, msg *icmpMessage) {
+	// Only Echo Request/Reply are tracked as a request/counterpart pair.
+	// Everything else (errors, Timestamp/Information/Address Mask
+	// messages, ...) is one-way as far as this package is concerned and
+	// is published exactly as observed, so its source/destination/
+	// direction reflect the packet on the wire rather than the reversal
+	// used to match an echo reply back to its request.
+	if !isEchoMessage(tuple, msg) {
+		icmp.publishStandalone(tuple, msg)
+		return
+	}
+
 	if isRequest(tuple, msg) {
 		icmp.processRequest(tuple, msg)
 	} else {
@@ -152,6 +247,13 @@ func (icmp *Icmp) processMessage(tuple *icmpTuple, msg *icmpMessage) {
 	}
 }
 
+// publishStandalone publishes a single ICMP message that is not part of a
+// tracked request/counterpart pair, using the tuple exactly as observed.
+func (icmp *Icmp) publishStandalone(tuple *icmpTuple, msg *icmpMessage) {
+	logp.Debug("icmp", "Processing standalone message. %s", tuple)
+	icmp.publishTransaction(&icmpTransaction{Ts: msg.Ts, Tuple: *tuple, Request: msg})
+}
+
 func (icmp *Icmp) processRequest(tuple *icmpTuple, msg *icmpMessage) {
 	logp.Debug("icmp", "Processing request. %s", tuple)
 
@@ -197,6 +299,19 @@ func (icmp *Icmp) direction(t *icmpTransaction) uint8 {
 	return directionLocalOnly
 }
 
+// networkDirection classifies a packet for the network.direction ECS field,
+// based on which side (if any) is a local address.
+func (icmp *Icmp) networkDirection(srcIp, dstIp net.IP) string {
+	switch {
+	case !icmp.isLocalIp(srcIp):
+		return "inbound"
+	case !icmp.isLocalIp(dstIp):
+		return "outbound"
+	default:
+		return "internal"
+	}
+}
+
 func (icmp *Icmp) isLocalIp(ip net.IP) bool {
 	if ip.IsLoopback() {
 		return true
@@ -242,15 +357,10 @@ func (icmp *Icmp) publishTransaction(trans *icmpTransaction) {
 
 	event := common.MapStr{}
 
-	// common fields - group "env"
-	event["client_ip"] = trans.Tuple.SrcIp
-	event["ip"] = trans.Tuple.DstIp
-
-	// common fields - group "event"
-	event["@timestamp"] = common.Time(trans.Ts) // timestamp of the first packet
-	event["type"] = "icmp"                      // protocol name
-	event["count"] = 1                          // reserved for future sampling support
-	event["path"] = trans.Tuple.DstIp           // what is requested (dst ip)
+	// event fields - group "event"
+	event["@timestamp"] = common.Time(trans.Ts)
+	event["type"] = "icmp"
+	event["count"] = 1 // reserved for future sampling support
 	if trans.HasError() {
 		event["status"] = common.ERROR_STATUS
 	} else {
@@ -260,25 +370,49 @@ func (icmp *Icmp) publishTransaction(trans *icmpTransaction) {
 		event["notes"] = trans.Notes
 	}
 
-	// common fields - group "measurements"
-	responsetime, hasResponseTime := trans.ResponseTimeMillis()
-	if hasResponseTime {
-		event["responsetime"] = responsetime
+	ecsEvent := common.MapStr{"dataset": "icmp"}
+	event["event"] = ecsEvent
+	ecsEvent["start"] = common.Time(trans.Ts)
+	if trans.Response != nil {
+		ecsEvent["end"] = common.Time(trans.Response.Ts)
+		ecsEvent["duration"] = trans.Response.Ts.Sub(trans.Ts).Nanoseconds()
+	}
+
+	// event fields - group "network"
+	network := common.MapStr{}
+	event["network"] = network
+	if trans.Tuple.IcmpVersion == 4 {
+		network["transport"] = "icmp"
+		network["type"] = "ipv4"
+	} else {
+		network["transport"] = "ipv6-icmp"
+		network["type"] = "ipv6"
 	}
 	switch icmp.direction(trans) {
-	case directionFromInside:
-		if trans.Request != nil {
-			event["bytes_out"] = trans.Request.Length
-		}
-		if trans.Response != nil {
-			event["bytes_in"] = trans.Response.Length
-		}
 	case directionFromOutside:
+		network["direction"] = "inbound"
+	case directionFromInside:
+		network["direction"] = "outbound"
+	default:
+		network["direction"] = "internal"
+	}
+	if id := communityID(trans); id != "" {
+		network["community_id"] = id
+	}
+
+	// event fields - group "source"/"destination"
+	event["source"] = common.MapStr{"ip": trans.Tuple.SrcIp}
+	event["destination"] = common.MapStr{"ip": trans.Tuple.DstIp}
+	if trans.Request != nil {
+		event["source"].(common.MapStr)["bytes"] = trans.Request.Length
+		network["bytes"] = trans.Request.Length
+	}
+	if trans.Response != nil {
+		event["destination"].(common.MapStr)["bytes"] = trans.Response.Length
 		if trans.Request != nil {
-			event["bytes_in"] = trans.Request.Length
-		}
-		if trans.Response != nil {
-			event["bytes_out"] = trans.Response.Length
+			network["bytes"] = trans.Request.Length + trans.Response.Length
+		} else {
+			network["bytes"] = trans.Response.Length
 		}
 	}
 
@@ -296,10 +430,9 @@ func (icmp *Icmp) publishTransaction(trans *icmpTransaction) {
 		request["type"] = trans.Request.Type
 		request["code"] = trans.Request.Code
 
-		// TODO: Add more info. The IPv4/IPv6 payload could be interesting.
-		// if icmp.SendRequest {
-		//     request["payload"] = ""
-		// }
+		if icmp.sendRequest && len(trans.Request.Payload) > 0 {
+			request["payload"] = trans.Request.Payload
+		}
 	}
 
 	if trans.Response != nil {
@@ -310,11 +443,70 @@ func (icmp *Icmp) publishTransaction(trans *icmpTransaction) {
 		response["type"] = trans.Response.Type
 		response["code"] = trans.Response.Code
 
-		// TODO: Add more info. The IPv4/IPv6 payload could be interesting.
-		// if icmp.SendResponse {
-		//     response["payload"] = ""
-		// }
+		if icmp.sendResponse && len(trans.Response.Payload) > 0 {
+			response["payload"] = trans.Response.Payload
+		}
+	}
+
+	if orig := trans.originalDatagramOf(); orig != nil {
+		icmpEvent["original_datagram"] = orig.toMapStr()
+		icmp.addRelatedFlow(event, orig)
+	}
+
+	if icmp.legacyFields {
+		icmp.addLegacyFields(event, trans)
 	}
 
 	icmp.results.PublishEvent(event)
 }
+
+// addRelatedFlow sets related.ip and, when the flows subsystem recognizes
+// the original datagram's tuple as a live flow, flow.id.
+func (icmp *Icmp) addRelatedFlow(event common.MapStr, orig *originalDatagram) {
+	event["related"] = common.MapStr{"ip": []net.IP{orig.SrcIp, orig.DstIp}}
+
+	if icmp.flows == nil || !orig.HasPorts {
+		return
+	}
+
+	tuple := common.IpPortTuple{
+		Src_ip:   orig.SrcIp,
+		Dst_ip:   orig.DstIp,
+		Src_port: orig.SrcPort,
+		Dst_port: orig.DstPort,
+	}
+	if flowId, found := icmp.flows.FlowID(&tuple, orig.Proto); found {
+		event["flow"] = common.MapStr{"id": flowId}
+	}
+}
+
+// addLegacyFields populates the flat client_ip/bytes_in/bytes_out/
+// responsetime fields that were published before the move to ECS, for
+// users who still depend on them downstream.
+func (icmp *Icmp) addLegacyFields(event common.MapStr, trans *icmpTransaction) {
+	event["client_ip"] = trans.Tuple.SrcIp
+	event["ip"] = trans.Tuple.DstIp
+	event["path"] = trans.Tuple.DstIp
+
+	responsetime, hasResponseTime := trans.ResponseTimeMillis()
+	if hasResponseTime {
+		event["responsetime"] = responsetime
+	}
+
+	switch icmp.direction(trans) {
+	case directionFromInside:
+		if trans.Request != nil {
+			event["bytes_out"] = trans.Request.Length
+		}
+		if trans.Response != nil {
+			event["bytes_in"] = trans.Response.Length
+		}
+	case directionFromOutside:
+		if trans.Request != nil {
+			event["bytes_in"] = trans.Request.Length
+		}
+		if trans.Response != nil {
+			event["bytes_out"] = trans.Response.Length
+		}
+	}
+}
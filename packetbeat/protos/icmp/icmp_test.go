@@ -0,0 +1,82 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/elastic/libbeat/common"
+)
+
+// stubFlowLookup is a minimal FlowIdLookup for testing addRelatedFlow
+// without depending on the real flows subsystem.
+type stubFlowLookup struct {
+	flowId string
+	found  bool
+}
+
+func (s stubFlowLookup) FlowID(tuple *common.IpPortTuple, proto uint8) (string, bool) {
+	return s.flowId, s.found
+}
+
+func TestAddRelatedFlowAlwaysSetsRelatedIP(t *testing.T) {
+	icmp := &Icmp{}
+	orig := &originalDatagram{SrcIp: net.ParseIP("10.0.0.1"), DstIp: net.ParseIP("10.0.0.2")}
+
+	event := common.MapStr{}
+	icmp.addRelatedFlow(event, orig)
+
+	related, ok := event["related"].(common.MapStr)
+	if !ok {
+		t.Fatalf("event[\"related\"] = %v, want a common.MapStr", event["related"])
+	}
+	ips, ok := related["ip"].([]net.IP)
+	if !ok || len(ips) != 2 || !ips[0].Equal(orig.SrcIp) || !ips[1].Equal(orig.DstIp) {
+		t.Errorf("related.ip = %v, want [%s %s]", related["ip"], orig.SrcIp, orig.DstIp)
+	}
+	if _, hasFlow := event["flow"]; hasFlow {
+		t.Errorf("flow.id should not be set when no flows subsystem is wired in")
+	}
+}
+
+func TestAddRelatedFlowMatchSetsFlowID(t *testing.T) {
+	icmp := &Icmp{flows: stubFlowLookup{flowId: "flow-123", found: true}}
+	orig := &originalDatagram{
+		SrcIp: net.ParseIP("10.0.0.1"), DstIp: net.ParseIP("10.0.0.2"),
+		Proto: 6, SrcPort: 1234, DstPort: 80, HasPorts: true,
+	}
+
+	event := common.MapStr{}
+	icmp.addRelatedFlow(event, orig)
+
+	flow, ok := event["flow"].(common.MapStr)
+	if !ok || flow["id"] != "flow-123" {
+		t.Errorf("event[\"flow\"] = %v, want {id: flow-123}", event["flow"])
+	}
+}
+
+func TestAddRelatedFlowNoMatchLeavesFlowUnset(t *testing.T) {
+	icmp := &Icmp{flows: stubFlowLookup{found: false}}
+	orig := &originalDatagram{
+		SrcIp: net.ParseIP("10.0.0.1"), DstIp: net.ParseIP("10.0.0.2"),
+		Proto: 6, SrcPort: 1234, DstPort: 80, HasPorts: true,
+	}
+
+	event := common.MapStr{}
+	icmp.addRelatedFlow(event, orig)
+
+	if _, hasFlow := event["flow"]; hasFlow {
+		t.Errorf("flow.id should not be set when the flows subsystem reports no match")
+	}
+}
+
+func TestAddRelatedFlowWithoutPortsSkipsLookup(t *testing.T) {
+	icmp := &Icmp{flows: stubFlowLookup{flowId: "flow-123", found: true}}
+	orig := &originalDatagram{SrcIp: net.ParseIP("10.0.0.1"), DstIp: net.ParseIP("10.0.0.2"), HasPorts: false}
+
+	event := common.MapStr{}
+	icmp.addRelatedFlow(event, orig)
+
+	if _, hasFlow := event["flow"]; hasFlow {
+		t.Errorf("flow.id should not be looked up for an original datagram without ports (e.g. ICMP-in-ICMP)")
+	}
+}
@@ -0,0 +1,105 @@
+package icmp
+
+import (
+	"encoding/binary"
+
+	"github.com/elastic/libbeat/common"
+
+	"github.com/elastic/packetbeat/protos"
+)
+
+// Multicast Listener Discovery message types (RFC 2710, RFC 3810).
+const (
+	icmpV6MLDv1Query  = 130
+	icmpV6MLDv1Report = 131
+	icmpV6MLDv1Done   = 132
+	icmpV6MLDv2Report = 143
+)
+
+// isMLDType reports whether an ICMPv6 message is part of Multicast
+// Listener Discovery. Like NDP messages, these are published individually
+// rather than tracked in the transactions cache.
+func isMLDType(typ uint8) bool {
+	switch typ {
+	case icmpV6MLDv1Query, icmpV6MLDv1Report, icmpV6MLDv1Done, icmpV6MLDv2Report:
+		return true
+	}
+	return false
+}
+
+// publishMLD decodes and publishes a single MLD message as a standalone
+// event.
+func (icmp *Icmp) publishMLD(pkt *protos.Packet, typ, code uint8, payload []byte) {
+	if icmp.results == nil {
+		return
+	}
+
+	event := common.MapStr{
+		"@timestamp": common.Time(pkt.Ts),
+		"type":       "icmp",
+		"count":      1,
+		"status":     common.OK_STATUS,
+	}
+	event["event"] = common.MapStr{"dataset": "icmp", "start": common.Time(pkt.Ts)}
+	event["network"] = common.MapStr{
+		"transport": "ipv6-icmp",
+		"type":      "ipv6",
+		"direction": icmp.networkDirection(pkt.Tuple.Src_ip, pkt.Tuple.Dst_ip),
+	}
+	event["source"] = common.MapStr{"ip": pkt.Tuple.Src_ip}
+	event["destination"] = common.MapStr{"ip": pkt.Tuple.Dst_ip}
+	event["icmp"] = common.MapStr{
+		"version": uint8(6),
+		"message": humanReadable(&icmpTuple{IcmpVersion: 6}, &icmpMessage{Type: typ, Code: code}),
+		"type":    typ,
+		"code":    code,
+		"mld":     decodeMLD(typ, payload),
+	}
+
+	icmp.results.PublishEvent(event)
+}
+
+// decodeMLD parses an MLDv1 query/report/done or MLDv2 report into the
+// fields published under icmp.mld.
+func decodeMLD(typ uint8, payload []byte) common.MapStr {
+	mld := common.MapStr{}
+
+	switch typ {
+	case icmpV6MLDv1Query, icmpV6MLDv1Report, icmpV6MLDv1Done:
+		if len(payload) < 20 {
+			return mld
+		}
+		mld["maximum_response_delay"] = binary.BigEndian.Uint16(payload[0:2])
+		mld["multicast_address"] = ipString(payload[4:20])
+
+	case icmpV6MLDv2Report:
+		if len(payload) < 4 {
+			return mld
+		}
+		numRecords := int(binary.BigEndian.Uint16(payload[2:4]))
+		mld["number_of_records"] = numRecords
+
+		var records []common.MapStr
+		offset := 4
+		for i := 0; i < numRecords && offset+20 <= len(payload); i++ {
+			auxLen := int(payload[offset+1])
+			numSources := int(binary.BigEndian.Uint16(payload[offset+2 : offset+4]))
+			recordLen := 20 + numSources*16 + auxLen*4
+			if offset+recordLen > len(payload) {
+				break
+			}
+
+			records = append(records, common.MapStr{
+				"record_type":       payload[offset],
+				"multicast_address": ipString(payload[offset+4 : offset+20]),
+				"number_of_sources": numSources,
+			})
+			offset += recordLen
+		}
+		if len(records) > 0 {
+			mld["records"] = records
+		}
+	}
+
+	return mld
+}
@@ -0,0 +1,89 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/elastic/libbeat/common"
+)
+
+func TestDecodeMLDv1Query(t *testing.T) {
+	payload := make([]byte, 20)
+	binary.BigEndian.PutUint16(payload[0:2], 10000)
+	copy(payload[4:20], net.ParseIP("ff02::1").To16())
+
+	mld := decodeMLD(icmpV6MLDv1Query, payload)
+	if mld["maximum_response_delay"] != uint16(10000) {
+		t.Errorf("maximum_response_delay = %v, want 10000", mld["maximum_response_delay"])
+	}
+	if mld["multicast_address"] != "ff02::1" {
+		t.Errorf("multicast_address = %v, want ff02::1", mld["multicast_address"])
+	}
+}
+
+func TestDecodeMLDv1TooShortReturnsEmpty(t *testing.T) {
+	mld := decodeMLD(icmpV6MLDv1Report, make([]byte, 4))
+	if len(mld) != 0 {
+		t.Errorf("decodeMLD() on truncated payload = %v, want empty", mld)
+	}
+}
+
+func TestDecodeMLDv2ReportMultipleRecords(t *testing.T) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint16(payload[2:4], 2) // number_of_records
+
+	record := func(mcast string, numSources int) []byte {
+		r := make([]byte, 20+numSources*16)
+		r[0] = 1 // record type
+		binary.BigEndian.PutUint16(r[2:4], uint16(numSources))
+		copy(r[4:20], net.ParseIP(mcast).To16())
+		return r
+	}
+
+	payload = append(payload, record("ff02::1", 0)...)
+	payload = append(payload, record("ff02::2", 1)...)
+
+	mld := decodeMLD(icmpV6MLDv2Report, payload)
+	if mld["number_of_records"] != 2 {
+		t.Errorf("number_of_records = %v, want 2", mld["number_of_records"])
+	}
+
+	records, ok := mld["records"].([]common.MapStr)
+	if !ok || len(records) != 2 {
+		t.Fatalf("records = %v, want 2 decoded records", mld["records"])
+	}
+	if records[0]["multicast_address"] != "ff02::1" {
+		t.Errorf("records[0].multicast_address = %v, want ff02::1", records[0]["multicast_address"])
+	}
+	if records[1]["multicast_address"] != "ff02::2" || records[1]["number_of_sources"] != 1 {
+		t.Errorf("records[1] = %v, want multicast_address ff02::2 number_of_sources 1", records[1])
+	}
+}
+
+func TestDecodeMLDv2ReportStopsOnTruncatedRecord(t *testing.T) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint16(payload[2:4], 2) // claims 2 records but only has room for one
+
+	r := make([]byte, 20)
+	r[0] = 1
+	copy(r[4:20], net.ParseIP("ff02::1").To16())
+	payload = append(payload, r...)
+
+	mld := decodeMLD(icmpV6MLDv2Report, payload)
+	records, ok := mld["records"].([]common.MapStr)
+	if !ok || len(records) != 1 {
+		t.Fatalf("records = %v, want exactly 1 decoded record", mld["records"])
+	}
+}
+
+func TestIsMLDType(t *testing.T) {
+	for _, typ := range []uint8{130, 131, 132, 143} {
+		if !isMLDType(typ) {
+			t.Errorf("isMLDType(%d) = false, want true", typ)
+		}
+	}
+	if isMLDType(icmpV6EchoRequest) {
+		t.Errorf("isMLDType(EchoRequest) = true, want false")
+	}
+}
@@ -0,0 +1,175 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/elastic/libbeat/common"
+
+	"github.com/elastic/packetbeat/protos"
+)
+
+// ICMPv6 Neighbor Discovery message types (RFC 4861) and Redirect (which
+// also carries NDP options).
+const (
+	icmpV6RouterSolicitation    = 133
+	icmpV6RouterAdvertisement   = 134
+	icmpV6NeighborSolicitation  = 135
+	icmpV6NeighborAdvertisement = 136
+	icmpV6Redirect              = 137
+)
+
+// NDP option types (RFC 4861).
+const (
+	ndpOptSourceLinkLayerAddr = 1
+	ndpOptTargetLinkLayerAddr = 2
+	ndpOptPrefixInfo          = 3
+	ndpOptMTU                 = 5
+)
+
+// isNDPType reports whether an ICMPv6 message is part of Neighbor
+// Discovery. These are stateless autoconfig/discovery messages, not
+// request/response pairs, and are published individually rather than
+// being tracked in the transactions cache.
+func isNDPType(typ uint8) bool {
+	switch typ {
+	case icmpV6RouterSolicitation, icmpV6RouterAdvertisement,
+		icmpV6NeighborSolicitation, icmpV6NeighborAdvertisement,
+		icmpV6Redirect:
+		return true
+	}
+	return false
+}
+
+// publishNDP decodes and publishes a single Neighbor Discovery message as a
+// standalone event.
+func (icmp *Icmp) publishNDP(pkt *protos.Packet, typ, code uint8, payload []byte) {
+	if icmp.results == nil {
+		return
+	}
+
+	event := common.MapStr{
+		"@timestamp": common.Time(pkt.Ts),
+		"type":       "icmp",
+		"count":      1,
+		"status":     common.OK_STATUS,
+	}
+	event["event"] = common.MapStr{"dataset": "icmp", "start": common.Time(pkt.Ts)}
+	event["network"] = common.MapStr{
+		"transport": "ipv6-icmp",
+		"type":      "ipv6",
+		"direction": icmp.networkDirection(pkt.Tuple.Src_ip, pkt.Tuple.Dst_ip),
+	}
+	event["source"] = common.MapStr{"ip": pkt.Tuple.Src_ip}
+	event["destination"] = common.MapStr{"ip": pkt.Tuple.Dst_ip}
+	event["icmp"] = common.MapStr{
+		"version": uint8(6),
+		"message": humanReadable(&icmpTuple{IcmpVersion: 6}, &icmpMessage{Type: typ, Code: code}),
+		"type":    typ,
+		"code":    code,
+		"ndp":     decodeNDP(typ, payload),
+	}
+
+	icmp.results.PublishEvent(event)
+}
+
+// decodeNDP parses the fixed part and TLV options of a Neighbor Discovery
+// message, returning the fields to publish under icmp.ndp.
+func decodeNDP(typ uint8, payload []byte) common.MapStr {
+	ndp := common.MapStr{}
+	offset := 0
+
+	switch typ {
+	case icmpV6RouterSolicitation:
+		offset = 4 // 4 reserved bytes
+
+	case icmpV6RouterAdvertisement:
+		if len(payload) < 12 {
+			return ndp
+		}
+		ndp["cur_hop_limit"] = payload[0]
+		ndp["managed_address_config"] = payload[1]&0x80 != 0
+		ndp["other_config"] = payload[1]&0x40 != 0
+		ndp["router_lifetime"] = binary.BigEndian.Uint16(payload[2:4])
+		ndp["reachable_time"] = binary.BigEndian.Uint32(payload[4:8])
+		ndp["retrans_timer"] = binary.BigEndian.Uint32(payload[8:12])
+		offset = 12
+
+	case icmpV6NeighborSolicitation, icmpV6NeighborAdvertisement:
+		if len(payload) < 20 {
+			return ndp
+		}
+		if typ == icmpV6NeighborAdvertisement {
+			ndp["router"] = payload[0]&0x80 != 0
+			ndp["solicited"] = payload[0]&0x40 != 0
+			ndp["override"] = payload[0]&0x20 != 0
+		}
+		ndp["target_address"] = ipString(payload[4:20])
+		offset = 20
+
+	case icmpV6Redirect:
+		if len(payload) < 36 {
+			return ndp
+		}
+		ndp["target_address"] = ipString(payload[4:20])
+		ndp["destination_address"] = ipString(payload[20:36])
+		offset = 36
+	}
+
+	if offset > len(payload) {
+		return ndp
+	}
+	if options := decodeNDPOptions(payload[offset:]); len(options) > 0 {
+		ndp["options"] = options
+	}
+	return ndp
+}
+
+// decodeNDPOptions walks the TLV options that follow the fixed part of an
+// NDP message (source/target link-layer address, prefix info, MTU, ...).
+func decodeNDPOptions(data []byte) []common.MapStr {
+	var options []common.MapStr
+	for len(data) >= 8 {
+		optLen := int(data[1]) * 8 // option length is in units of 8 octets
+		if optLen == 0 || optLen > len(data) {
+			break
+		}
+		body := data[2:optLen]
+
+		opt := common.MapStr{}
+		switch data[0] {
+		case ndpOptSourceLinkLayerAddr:
+			opt["type"] = "source_link_layer_address"
+			opt["address"] = net.HardwareAddr(body).String()
+		case ndpOptTargetLinkLayerAddr:
+			opt["type"] = "target_link_layer_address"
+			opt["address"] = net.HardwareAddr(body).String()
+		case ndpOptPrefixInfo:
+			opt["type"] = "prefix_information"
+			if len(body) >= 30 {
+				opt["prefix_length"] = body[0]
+				opt["on_link"] = body[1]&0x80 != 0
+				opt["autonomous"] = body[1]&0x40 != 0
+				opt["valid_lifetime"] = binary.BigEndian.Uint32(body[2:6])
+				opt["preferred_lifetime"] = binary.BigEndian.Uint32(body[6:10])
+				opt["prefix"] = ipString(body[14:30])
+			}
+		case ndpOptMTU:
+			opt["type"] = "mtu"
+			if len(body) >= 6 {
+				opt["mtu"] = binary.BigEndian.Uint32(body[2:6])
+			}
+		default:
+			opt["type"] = "unknown"
+			opt["raw_type"] = data[0]
+		}
+
+		options = append(options, opt)
+		data = data[optLen:]
+	}
+	return options
+}
+
+func ipString(b []byte) string {
+	return net.IP(append([]byte(nil), b...)).String()
+}
@@ -0,0 +1,130 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/elastic/libbeat/common"
+)
+
+func TestDecodeNDPRouterAdvertisement(t *testing.T) {
+	payload := make([]byte, 12)
+	payload[0] = 64   // cur hop limit
+	payload[1] = 0xc0 // managed + other
+	binary.BigEndian.PutUint16(payload[2:4], 1800)
+	binary.BigEndian.PutUint32(payload[4:8], 0)
+	binary.BigEndian.PutUint32(payload[8:12], 0)
+
+	ndp := decodeNDP(icmpV6RouterAdvertisement, payload)
+	if ndp["cur_hop_limit"] != byte(64) {
+		t.Errorf("cur_hop_limit = %v, want 64", ndp["cur_hop_limit"])
+	}
+	if ndp["managed_address_config"] != true || ndp["other_config"] != true {
+		t.Errorf("managed_address_config/other_config not decoded from flags byte 0xc0: %v", ndp)
+	}
+	if ndp["router_lifetime"] != uint16(1800) {
+		t.Errorf("router_lifetime = %v, want 1800", ndp["router_lifetime"])
+	}
+}
+
+func TestDecodeNDPNeighborSolicitationWithSourceLinkLayerOption(t *testing.T) {
+	payload := make([]byte, 20)
+	copy(payload[4:20], net.ParseIP("fe80::1").To16())
+
+	// Source Link-Layer Address option: type=1, length=1 (8 octets), 6-byte MAC.
+	mac := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	opt := append([]byte{ndpOptSourceLinkLayerAddr, 1}, mac...)
+	payload = append(payload, opt...)
+
+	ndp := decodeNDP(icmpV6NeighborSolicitation, payload)
+	if ndp["target_address"] != "fe80::1" {
+		t.Errorf("target_address = %v, want fe80::1", ndp["target_address"])
+	}
+
+	options, ok := ndp["options"].([]common.MapStr)
+	if !ok || len(options) != 1 {
+		t.Fatalf("options = %v, want a single decoded option", ndp["options"])
+	}
+	if options[0]["type"] != "source_link_layer_address" {
+		t.Errorf("option type = %v, want source_link_layer_address", options[0]["type"])
+	}
+}
+
+func TestDecodeNDPRedirect(t *testing.T) {
+	payload := make([]byte, 36)
+	copy(payload[4:20], net.ParseIP("fe80::1").To16())
+	copy(payload[20:36], net.ParseIP("2001:db8::1").To16())
+
+	ndp := decodeNDP(icmpV6Redirect, payload)
+	if ndp["target_address"] != "fe80::1" {
+		t.Errorf("target_address = %v, want fe80::1", ndp["target_address"])
+	}
+	if ndp["destination_address"] != "2001:db8::1" {
+		t.Errorf("destination_address = %v, want 2001:db8::1", ndp["destination_address"])
+	}
+}
+
+func TestDecodeNDPTooShortReturnsEmpty(t *testing.T) {
+	ndp := decodeNDP(icmpV6NeighborAdvertisement, make([]byte, 4))
+	if len(ndp) != 0 {
+		t.Errorf("decodeNDP() on truncated payload = %v, want empty", ndp)
+	}
+}
+
+func TestDecodeNDPOptionsSourceLinkLayerAddress(t *testing.T) {
+	mac := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	opt := append([]byte{ndpOptSourceLinkLayerAddr, 1}, mac...)
+
+	options := decodeNDPOptions(opt)
+	if len(options) != 1 {
+		t.Fatalf("got %d options, want 1", len(options))
+	}
+	if options[0]["type"] != "source_link_layer_address" {
+		t.Errorf("type = %v, want source_link_layer_address", options[0]["type"])
+	}
+	if options[0]["address"] != net.HardwareAddr(mac).String() {
+		t.Errorf("address = %v, want %v", options[0]["address"], net.HardwareAddr(mac).String())
+	}
+}
+
+func TestDecodeNDPOptionsPrefixInformation(t *testing.T) {
+	body := make([]byte, 30)
+	body[0] = 64   // prefix length
+	body[1] = 0xc0 // on-link + autonomous
+	binary.BigEndian.PutUint32(body[2:6], 3600)
+	binary.BigEndian.PutUint32(body[6:10], 1800)
+	copy(body[14:30], net.ParseIP("2001:db8::").To16())
+	opt := append([]byte{ndpOptPrefixInfo, 4}, body...)
+
+	options := decodeNDPOptions(opt)
+	if len(options) != 1 {
+		t.Fatalf("got %d options, want 1", len(options))
+	}
+	if options[0]["prefix"] != "2001:db8::" {
+		t.Errorf("prefix = %v, want 2001:db8::", options[0]["prefix"])
+	}
+	if options[0]["on_link"] != true || options[0]["autonomous"] != true {
+		t.Errorf("on_link/autonomous not decoded: %v", options[0])
+	}
+}
+
+func TestDecodeNDPOptionsStopsOnZeroOrOversizedLength(t *testing.T) {
+	if got := decodeNDPOptions([]byte{1, 0, 0, 0, 0, 0, 0, 0}); got != nil {
+		t.Errorf("zero-length option should stop parsing, got %v", got)
+	}
+	if got := decodeNDPOptions([]byte{1, 0xff, 0, 0, 0, 0, 0, 0}); got != nil {
+		t.Errorf("oversized option length should stop parsing, got %v", got)
+	}
+}
+
+func TestIsNDPType(t *testing.T) {
+	for _, typ := range []uint8{133, 134, 135, 136, 137} {
+		if !isNDPType(typ) {
+			t.Errorf("isNDPType(%d) = false, want true", typ)
+		}
+	}
+	if isNDPType(icmpV6EchoRequest) {
+		t.Errorf("isNDPType(EchoRequest) = true, want false")
+	}
+}
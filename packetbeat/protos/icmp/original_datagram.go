@@ -0,0 +1,109 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// originalDatagram is the inner IP header + first 8 bytes of the datagram
+// that provoked an ICMP error, as embedded in the error message's payload.
+type originalDatagram struct {
+	SrcIp, DstIp     net.IP
+	Proto            uint8
+	SrcPort, DstPort uint16
+	HasPorts         bool
+}
+
+// isErrorTypeV4 reports whether an ICMPv4 message of this type carries an
+// embedded IP header identifying the datagram that caused it.
+func isErrorTypeV4(typ uint8) bool {
+	switch typ {
+	case 3, // Destination Unreachable
+		4,  // Source Quench
+		5,  // Redirect
+		11, // Time Exceeded
+		12: // Parameter Problem
+		return true
+	}
+	return false
+}
+
+// isErrorTypeV6 reports whether an ICMPv6 message of this type carries an
+// embedded IP header identifying the datagram that caused it.
+func isErrorTypeV6(typ uint8) bool {
+	switch typ {
+	case 1, // Destination Unreachable
+		2, // Packet Too Big
+		3, // Time Exceeded
+		4: // Parameter Problem
+		return true
+	}
+	return false
+}
+
+// parseOriginalDatagramV4 extracts the inner IPv4 header and the first 8
+// bytes of the original datagram embedded in the payload of an ICMPv4
+// error message.
+func parseOriginalDatagramV4(payload []byte) (*originalDatagram, bool) {
+	if len(payload) < 20 {
+		return nil, false
+	}
+	ihl := int(payload[0]&0x0f) * 4
+	if ihl < 20 || len(payload) < ihl+8 {
+		return nil, false
+	}
+
+	orig := &originalDatagram{
+		Proto: payload[9],
+		SrcIp: net.IP(append([]byte(nil), payload[12:16]...)),
+		DstIp: net.IP(append([]byte(nil), payload[16:20]...)),
+	}
+	fillOriginalPorts(orig, payload[ihl:ihl+8])
+	return orig, true
+}
+
+// parseOriginalDatagramV6 extracts the inner IPv6 header and the first 8
+// bytes of the original datagram embedded in the payload of an ICMPv6
+// error message. Extension headers on the original datagram are not
+// walked; the next header is assumed to directly follow the fixed IPv6
+// header, which holds for the common TCP/UDP case.
+func parseOriginalDatagramV6(payload []byte) (*originalDatagram, bool) {
+	const ipv6HeaderLen = 40
+	if len(payload) < ipv6HeaderLen+8 {
+		return nil, false
+	}
+
+	orig := &originalDatagram{
+		Proto: payload[6],
+		SrcIp: net.IP(append([]byte(nil), payload[8:24]...)),
+		DstIp: net.IP(append([]byte(nil), payload[24:40]...)),
+	}
+	fillOriginalPorts(orig, payload[ipv6HeaderLen:ipv6HeaderLen+8])
+	return orig, true
+}
+
+// fillOriginalPorts reads the source/destination ports out of the first 8
+// bytes of the original transport header, when the protocol has them.
+func fillOriginalPorts(orig *originalDatagram, transportHeader []byte) {
+	switch orig.Proto {
+	case 6, 17: // TCP, UDP
+		orig.SrcPort = binary.BigEndian.Uint16(transportHeader[0:2])
+		orig.DstPort = binary.BigEndian.Uint16(transportHeader[2:4])
+		orig.HasPorts = true
+	}
+}
+
+// toMapStr renders the original datagram for the icmp.original_datagram
+// event field.
+func (o *originalDatagram) toMapStr() map[string]interface{} {
+	m := map[string]interface{}{
+		"src_ip": o.SrcIp,
+		"dst_ip": o.DstIp,
+		"proto":  o.Proto,
+	}
+	if o.HasPorts {
+		m["src_port"] = o.SrcPort
+		m["dst_port"] = o.DstPort
+	}
+	return m
+}
@@ -0,0 +1,104 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+)
+
+// ipv4Header builds a minimal (no options) IPv4 header followed by an
+// 8-byte transport header, as would be embedded in an ICMP error payload.
+func ipv4Header(proto byte, src, dst net.IP, transport [8]byte) []byte {
+	header := make([]byte, 20)
+	header[0] = 0x45 // version 4, IHL 5 (20 bytes)
+	header[9] = proto
+	copy(header[12:16], src.To4())
+	copy(header[16:20], dst.To4())
+	return append(header, transport[:]...)
+}
+
+func TestParseOriginalDatagramV4TCP(t *testing.T) {
+	var transport [8]byte
+	transport[0], transport[1] = 0x00, 0x50 // src port 80
+	transport[2], transport[3] = 0x1f, 0x90  // dst port 8080
+
+	payload := ipv4Header(6, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), transport)
+
+	orig, ok := parseOriginalDatagramV4(payload)
+	if !ok {
+		t.Fatal("parseOriginalDatagramV4() returned ok=false")
+	}
+	if !orig.SrcIp.Equal(net.ParseIP("10.0.0.1")) || !orig.DstIp.Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("got src=%s dst=%s, want 10.0.0.1/10.0.0.2", orig.SrcIp, orig.DstIp)
+	}
+	if orig.Proto != 6 {
+		t.Errorf("Proto = %d, want 6", orig.Proto)
+	}
+	if !orig.HasPorts || orig.SrcPort != 80 || orig.DstPort != 8080 {
+		t.Errorf("got HasPorts=%v src_port=%d dst_port=%d, want true/80/8080", orig.HasPorts, orig.SrcPort, orig.DstPort)
+	}
+}
+
+func TestParseOriginalDatagramV4NonTransportProto(t *testing.T) {
+	var transport [8]byte
+	payload := ipv4Header(1, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), transport) // proto 1 = ICMP, no ports
+
+	orig, ok := parseOriginalDatagramV4(payload)
+	if !ok {
+		t.Fatal("parseOriginalDatagramV4() returned ok=false")
+	}
+	if orig.HasPorts {
+		t.Errorf("HasPorts = true for a protocol without ports")
+	}
+}
+
+func TestParseOriginalDatagramV4TooShort(t *testing.T) {
+	if _, ok := parseOriginalDatagramV4([]byte{0x45, 0x00, 0x00}); ok {
+		t.Errorf("parseOriginalDatagramV4() on truncated input returned ok=true")
+	}
+}
+
+func TestParseOriginalDatagramV6UDP(t *testing.T) {
+	header := make([]byte, 40)
+	header[6] = 17 // UDP
+	copy(header[8:24], net.ParseIP("2001:db8::1").To16())
+	copy(header[24:40], net.ParseIP("2001:db8::2").To16())
+	transport := []byte{0x13, 0x88, 0x00, 0x35, 0x00, 0x00, 0x00, 0x00} // src 5000, dst 53
+	payload := append(header, transport...)
+
+	orig, ok := parseOriginalDatagramV6(payload)
+	if !ok {
+		t.Fatal("parseOriginalDatagramV6() returned ok=false")
+	}
+	if !orig.SrcIp.Equal(net.ParseIP("2001:db8::1")) || !orig.DstIp.Equal(net.ParseIP("2001:db8::2")) {
+		t.Errorf("got src=%s dst=%s, want 2001:db8::1/2001:db8::2", orig.SrcIp, orig.DstIp)
+	}
+	if !orig.HasPorts || orig.SrcPort != 5000 || orig.DstPort != 53 {
+		t.Errorf("got HasPorts=%v src_port=%d dst_port=%d, want true/5000/53", orig.HasPorts, orig.SrcPort, orig.DstPort)
+	}
+}
+
+func TestParseOriginalDatagramV6TooShort(t *testing.T) {
+	if _, ok := parseOriginalDatagramV6(make([]byte, 10)); ok {
+		t.Errorf("parseOriginalDatagramV6() on truncated input returned ok=true")
+	}
+}
+
+func TestIsErrorType(t *testing.T) {
+	for _, typ := range []uint8{3, 4, 5, 11, 12} {
+		if !isErrorTypeV4(typ) {
+			t.Errorf("isErrorTypeV4(%d) = false, want true", typ)
+		}
+	}
+	if isErrorTypeV4(icmpV4EchoRequest) {
+		t.Errorf("isErrorTypeV4(EchoRequest) = true, want false")
+	}
+
+	for _, typ := range []uint8{1, 2, 3, 4} {
+		if !isErrorTypeV6(typ) {
+			t.Errorf("isErrorTypeV6(%d) = false, want true", typ)
+		}
+	}
+	if isErrorTypeV6(icmpV6EchoRequest) {
+		t.Errorf("isErrorTypeV6(EchoRequest) = true, want false")
+	}
+}
@@ -0,0 +1,300 @@
+package icmp
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/elastic/libbeat/logp"
+
+	"github.com/elastic/packetbeat/config"
+)
+
+// ProberTarget is a single host that the active prober sends periodic echo
+// requests to.
+type ProberTarget struct {
+	Host  string
+	Label string
+}
+
+// Prober actively sends ICMP echo requests to a configured list of targets
+// and feeds the replies back through Icmp.processMessage, so that
+// reachability monitoring produces the same transactions, fields and
+// publishing path as passively observed traffic.
+type Prober struct {
+	icmp *Icmp
+
+	targets  []ProberTarget
+	interval time.Duration
+	timeout  time.Duration
+	size     int
+
+	conn4 *icmp.PacketConn
+	conn6 *icmp.PacketConn
+
+	id  uint16
+	seq uint32
+
+	done chan struct{}
+}
+
+// NewProber creates a Prober that will publish its results through
+// icmpProto. It does not start sending packets until Start is called.
+func NewProber(icmpProto *Icmp, cfg config.IcmpProber) (*Prober, error) {
+	p := &Prober{
+		icmp:     icmpProto,
+		interval: 5 * time.Second,
+		timeout:  2 * time.Second,
+		size:     56,
+		id:       uint16(os.Getpid() & 0xffff),
+		done:     make(chan struct{}),
+	}
+
+	for _, t := range cfg.Targets {
+		p.targets = append(p.targets, ProberTarget{Host: t.Host, Label: t.Label})
+	}
+	if cfg.Interval != nil && *cfg.Interval > 0 {
+		p.interval = time.Duration(*cfg.Interval) * time.Second
+	}
+	if cfg.Timeout != nil && *cfg.Timeout > 0 {
+		p.timeout = time.Duration(*cfg.Timeout) * time.Second
+	}
+	if cfg.PacketSize != nil && *cfg.PacketSize > 0 {
+		p.size = *cfg.PacketSize
+	}
+
+	return p, nil
+}
+
+// Start opens the unprivileged ICMP datagram sockets ("udp4"/"udp6")
+// needed to reach the configured targets and
+// begins sending/receiving echo requests in the background. Call Stop to
+// shut it down.
+func (p *Prober) Start() error {
+	var err error
+	if p.hasVersion(4) {
+		p.conn4, err = icmp.ListenPacket("udp4", "0.0.0.0")
+		if err != nil {
+			return err
+		}
+		go p.listen(p.conn4, 4)
+	}
+	if p.hasVersion(6) {
+		p.conn6, err = icmp.ListenPacket("udp6", "::")
+		if err != nil {
+			return err
+		}
+		go p.listen(p.conn6, 6)
+	}
+
+	go p.sendLoop()
+	return nil
+}
+
+// Stop closes the ICMP sockets and stops the send loop.
+func (p *Prober) Stop() {
+	close(p.done)
+	if p.conn4 != nil {
+		p.conn4.Close()
+	}
+	if p.conn6 != nil {
+		p.conn6.Close()
+	}
+}
+
+// localAddr returns the local address to publish as the source (or
+// destination, for replies) of a probe, in the address family matching
+// version. It falls back to the family's zero address when no matching
+// local address was found, so the result is always of the requested
+// family. The zero address is not a local address to isLocalIp.
+func (p *Prober) localAddr(version uint8) net.IP {
+	for _, ip := range p.icmp.localIps {
+		if version == 4 && ip.To4() != nil {
+			return ip
+		}
+		if version == 6 && ip.To4() == nil {
+			return ip
+		}
+	}
+	if version == 6 {
+		return net.IPv6zero
+	}
+	return net.IPv4zero
+}
+
+func (p *Prober) hasVersion(version int) bool {
+	for _, t := range p.targets {
+		ips, err := resolveTarget(t.Host)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if (version == 4 && ip.To4() != nil) || (version == 6 && ip.To4() == nil) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveTarget resolves a configured target's Host to the IP addresses to
+// probe. Host may be a literal IP, in which case no DNS lookup happens, or
+// a hostname, which is resolved fresh on every call so a target's address
+// can change over time without requiring a restart.
+func resolveTarget(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return net.LookupIP(host)
+}
+
+func (p *Prober) sendLoop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			for _, target := range p.targets {
+				p.probe(target)
+			}
+		}
+	}
+}
+
+func (p *Prober) probe(target ProberTarget) {
+	ips, err := resolveTarget(target.Host)
+	if err != nil || len(ips) == 0 {
+		logp.Err("icmp", "Prober: could not resolve target %s: %s", target.Host, err)
+		return
+	}
+	dst := ips[0]
+
+	seq := uint16(atomic.AddUint32(&p.seq, 1))
+	payload := make([]byte, p.size)
+
+	var conn *icmp.PacketConn
+	var msgType icmp.Type
+	var version uint8
+	if dst.To4() != nil {
+		conn, msgType, version = p.conn4, ipv4.ICMPTypeEcho, 4
+	} else {
+		conn, msgType, version = p.conn6, ipv6.ICMPTypeEchoRequest, 6
+	}
+	if conn == nil {
+		logp.Warn("icmp", "Prober: no socket open for target %s (%s)", target.Host, target.Label)
+		return
+	}
+
+	wm := icmp.Message{
+		Type: msgType,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   int(p.id),
+			Seq:  int(seq),
+			Data: payload,
+		},
+	}
+	wb, err := wm.Marshal(nil)
+	if err != nil {
+		logp.Err("icmp", "Prober: failed to marshal echo request: %s", err)
+		return
+	}
+
+	// Feed the outgoing request into the regular processing pipeline so a
+	// transaction is created and waits for the matching reply, the same
+	// way one would for passively captured traffic.
+	requestMsg := &icmpMessage{
+		Ts:     time.Now(),
+		Type:   echoRequestType(version),
+		Code:   0,
+		Length: len(wb),
+	}
+	if p.icmp.sendRequest {
+		requestMsg.Payload = payload
+	}
+	p.icmp.processMessage(&icmpTuple{
+		IcmpVersion: version,
+		SrcIp:       p.localAddr(version),
+		DstIp:       dst,
+		Id:          p.id,
+		Seq:         seq,
+	}, requestMsg)
+
+	if _, err := conn.WriteTo(wb, &net.UDPAddr{IP: dst}); err != nil {
+		logp.Err("icmp", "Prober: failed to send echo request to %s: %s", target.Host, err)
+	}
+}
+
+func (p *Prober) listen(conn *icmp.PacketConn, version uint8) {
+	proto := ipv4.ICMPTypeEcho.Protocol()
+	if version == 6 {
+		proto = ipv6.ICMPTypeEchoReply.Protocol()
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-p.done:
+				return
+			default:
+				logp.Err("icmp", "Prober: read error: %s", err)
+				continue
+			}
+		}
+
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || uint16(echo.ID) != p.id {
+			continue
+		}
+
+		udpAddr, ok := peer.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		replyMsg := &icmpMessage{
+			Ts:     time.Now(),
+			Type:   echoReplyType(version),
+			Code:   0,
+			Length: n,
+		}
+		if p.icmp.sendResponse {
+			replyMsg.Payload = append([]byte(nil), buf[:n]...)
+		}
+		p.icmp.processMessage(&icmpTuple{
+			IcmpVersion: version,
+			SrcIp:       udpAddr.IP,
+			DstIp:       p.localAddr(version),
+			Id:          uint16(echo.ID),
+			Seq:         uint16(echo.Seq),
+		}, replyMsg)
+	}
+}
+
+func echoRequestType(version uint8) uint8 {
+	if version == 4 {
+		return icmpV4EchoRequest
+	}
+	return icmpV6EchoRequest
+}
+
+func echoReplyType(version uint8) uint8 {
+	if version == 4 {
+		return icmpV4EchoReply
+	}
+	return icmpV6EchoReply
+}
@@ -0,0 +1,125 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elastic/packetbeat/config"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestNewProberAppliesConfig(t *testing.T) {
+	cfg := config.IcmpProber{
+		Targets: []config.IcmpProberTarget{
+			{Host: "192.0.2.1", Label: "a"},
+			{Host: "2001:db8::1", Label: "b"},
+		},
+		Interval:   intPtr(10),
+		Timeout:    intPtr(3),
+		PacketSize: intPtr(128),
+	}
+
+	p, err := NewProber(&Icmp{}, cfg)
+	if err != nil {
+		t.Fatalf("NewProber() error = %s", err)
+	}
+	if p.interval != 10*time.Second {
+		t.Errorf("interval = %s, want 10s", p.interval)
+	}
+	if p.timeout != 3*time.Second {
+		t.Errorf("timeout = %s, want 3s", p.timeout)
+	}
+	if p.size != 128 {
+		t.Errorf("size = %d, want 128", p.size)
+	}
+	if len(p.targets) != 2 || p.targets[0].Host != "192.0.2.1" || p.targets[1].Label != "b" {
+		t.Errorf("targets = %v, want the two configured targets", p.targets)
+	}
+}
+
+func TestNewProberDefaultsWhenUnset(t *testing.T) {
+	p, err := NewProber(&Icmp{}, config.IcmpProber{})
+	if err != nil {
+		t.Fatalf("NewProber() error = %s", err)
+	}
+	if p.interval != 5*time.Second || p.timeout != 2*time.Second || p.size != 56 {
+		t.Errorf("got interval=%s timeout=%s size=%d, want interval=5s timeout=2s size=56", p.interval, p.timeout, p.size)
+	}
+}
+
+func TestProberHasVersionLiteralIPs(t *testing.T) {
+	p := &Prober{targets: []ProberTarget{
+		{Host: "192.0.2.1"},
+		{Host: "2001:db8::1"},
+	}}
+
+	if !p.hasVersion(4) {
+		t.Error("hasVersion(4) = false, want true for a v4 literal target")
+	}
+	if !p.hasVersion(6) {
+		t.Error("hasVersion(6) = false, want true for a v6 literal target")
+	}
+}
+
+func TestProberHasVersionNoMatch(t *testing.T) {
+	p := &Prober{targets: []ProberTarget{{Host: "192.0.2.1"}}}
+
+	if p.hasVersion(6) {
+		t.Error("hasVersion(6) = true, want false when only a v4 target is configured")
+	}
+}
+
+func TestProberHasVersionUnresolvableHostIsIgnored(t *testing.T) {
+	p := &Prober{targets: []ProberTarget{{Host: "this.host.does.not.resolve.invalid"}}}
+
+	if p.hasVersion(4) || p.hasVersion(6) {
+		t.Error("hasVersion() should ignore a target that fails to resolve, not treat it as either family")
+	}
+}
+
+func TestResolveTargetLiteralIP(t *testing.T) {
+	ips, err := resolveTarget("192.0.2.1")
+	if err != nil {
+		t.Fatalf("resolveTarget() error = %s", err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("resolveTarget() = %v, want [192.0.2.1] without a DNS lookup", ips)
+	}
+}
+
+func TestProberLocalAddrPicksMatchingFamily(t *testing.T) {
+	p := &Prober{icmp: &Icmp{localIps: []net.IP{
+		net.ParseIP("10.1.2.3"),
+		net.ParseIP("2001:db8::5"),
+	}}}
+
+	if got := p.localAddr(4); !got.Equal(net.ParseIP("10.1.2.3")) {
+		t.Errorf("localAddr(4) = %s, want 10.1.2.3", got)
+	}
+	if got := p.localAddr(6); !got.Equal(net.ParseIP("2001:db8::5")) {
+		t.Errorf("localAddr(6) = %s, want 2001:db8::5", got)
+	}
+}
+
+func TestProberLocalAddrFallsBackToZeroOfRequestedFamily(t *testing.T) {
+	p := &Prober{icmp: &Icmp{localIps: []net.IP{net.ParseIP("10.1.2.3")}}}
+
+	got := p.localAddr(6)
+	if !got.Equal(net.IPv6zero) {
+		t.Errorf("localAddr(6) = %s, want IPv6zero when no v6 local address is known", got)
+	}
+	if got.To4() != nil {
+		t.Errorf("localAddr(6) = %s, is a v4 address for v6 traffic", got)
+	}
+}
+
+func TestEchoRequestAndReplyTypesPerVersion(t *testing.T) {
+	if echoRequestType(4) != icmpV4EchoRequest || echoReplyType(4) != icmpV4EchoReply {
+		t.Error("v4 echo request/reply types do not match icmpV4EchoRequest/icmpV4EchoReply")
+	}
+	if echoRequestType(6) != icmpV6EchoRequest || echoReplyType(6) != icmpV6EchoReply {
+		t.Error("v6 echo request/reply types do not match icmpV6EchoRequest/icmpV6EchoReply")
+	}
+}
@@ -0,0 +1,219 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/tsg/gopacket/layers"
+)
+
+// ICMP types that are tracked as request/counterpart pairs. Everything
+// else is treated as a one-way message and published as soon as it is
+// seen.
+const (
+	icmpV4EchoReply   = 0
+	icmpV4EchoRequest = 8
+
+	icmpV6EchoRequest = 128
+	icmpV6EchoReply   = 129
+)
+
+// icmpTuple identifies an ICMP conversation. Unlike TCP/UDP, ICMP has no
+// port numbers, so the echo identifier and sequence number (when present)
+// are used in their place.
+type icmpTuple struct {
+	IcmpVersion  uint8
+	SrcIp, DstIp net.IP
+	Id, Seq      uint16
+}
+
+type hashableIcmpTuple [37]byte
+
+// Hashable returns a fixed-size, comparable representation of the tuple
+// suitable for use as a common.Cache key.
+func (t *icmpTuple) Hashable() hashableIcmpTuple {
+	var h hashableIcmpTuple
+	h[0] = t.IcmpVersion
+	copy(h[1:17], t.SrcIp.To16())
+	copy(h[17:33], t.DstIp.To16())
+	binary.BigEndian.PutUint16(h[33:35], t.Id)
+	binary.BigEndian.PutUint16(h[35:37], t.Seq)
+	return h
+}
+
+// Reverse returns the tuple as seen from the other side of the
+// conversation, i.e. with source and destination swapped.
+func (t *icmpTuple) Reverse() icmpTuple {
+	return icmpTuple{
+		IcmpVersion: t.IcmpVersion,
+		SrcIp:       t.DstIp,
+		DstIp:       t.SrcIp,
+		Id:          t.Id,
+		Seq:         t.Seq,
+	}
+}
+
+func (t *icmpTuple) String() string {
+	return fmt.Sprintf("IcmpTuple src[%s] dst[%s] id[%d] seq[%d]",
+		t.SrcIp, t.DstIp, t.Id, t.Seq)
+}
+
+// icmpMessage holds the parts of a single ICMP packet that are relevant to
+// building a transaction.
+type icmpMessage struct {
+	Ts     time.Time
+	Type   uint8
+	Code   uint8
+	Length int
+
+	// Payload is the raw ICMP payload, kept around only when the
+	// sendRequest/sendResponse config options are enabled so it can be
+	// attached to the published event.
+	Payload []byte
+
+	// OriginalDatagram holds the inner IP + transport header embedded in
+	// error-class messages (Destination Unreachable, Source Quench, Time
+	// Exceeded, Redirect, Parameter Problem, Packet Too Big), identifying the flow
+	// that provoked the error.
+	OriginalDatagram *originalDatagram
+}
+
+// icmpTransaction pairs a request with its counterpart response, when one
+// is expected and observed.
+type icmpTransaction struct {
+	Ts    time.Time
+	Tuple icmpTuple
+
+	Request  *icmpMessage
+	Response *icmpMessage
+
+	Notes []string
+}
+
+// originalDatagramOf returns the inner datagram embedded in whichever side
+// of the transaction carried one, if any.
+func (t *icmpTransaction) originalDatagramOf() *originalDatagram {
+	if t.Request != nil && t.Request.OriginalDatagram != nil {
+		return t.Request.OriginalDatagram
+	}
+	if t.Response != nil && t.Response.OriginalDatagram != nil {
+		return t.Response.OriginalDatagram
+	}
+	return nil
+}
+
+// HasError reports whether the transaction was closed under an exceptional
+// condition (duplicate, orphaned request/response, ...).
+func (t *icmpTransaction) HasError() bool {
+	return len(t.Notes) > 0
+}
+
+// ResponseTimeMillis returns the elapsed time between request and response,
+// when both were observed.
+func (t *icmpTransaction) ResponseTimeMillis() (int32, bool) {
+	if t.Request == nil || t.Response == nil {
+		return 0, false
+	}
+	return int32(t.Response.Ts.Sub(t.Request.Ts) / time.Millisecond), true
+}
+
+// isEchoMessage reports whether msg is part of an Echo Request/Reply
+// conversation, the only ICMP exchange this package tracks as a
+// request/counterpart pair. Every other type (errors, Timestamp/
+// Information/Address Mask request and reply, ...) is published as it is
+// observed, without the src/dst reversal used to match an echo reply back
+// to its request.
+func isEchoMessage(tuple *icmpTuple, msg *icmpMessage) bool {
+	switch tuple.IcmpVersion {
+	case 4:
+		return msg.Type == icmpV4EchoRequest || msg.Type == icmpV4EchoReply
+	case 6:
+		return msg.Type == icmpV6EchoRequest || msg.Type == icmpV6EchoReply
+	}
+	return false
+}
+
+// isRequest reports whether msg is the request-side of a tracked
+// conversation (as opposed to its counterpart or a standalone message).
+func isRequest(tuple *icmpTuple, msg *icmpMessage) bool {
+	switch tuple.IcmpVersion {
+	case 4:
+		return msg.Type == icmpV4EchoRequest
+	case 6:
+		return msg.Type == icmpV6EchoRequest
+	}
+	return true
+}
+
+// requiresCounterpart reports whether msg belongs to a conversation that is
+// expected to receive a matching response, and should therefore be held in
+// the transactions cache rather than published immediately.
+func requiresCounterpart(tuple *icmpTuple, msg *icmpMessage) bool {
+	switch tuple.IcmpVersion {
+	case 4:
+		return msg.Type == icmpV4EchoRequest
+	case 6:
+		return msg.Type == icmpV6EchoRequest
+	}
+	return false
+}
+
+// extractTrackingData pulls the echo identifier and sequence number out of
+// the ICMP payload, when the message type carries one.
+func extractTrackingData(version, typ uint8, base *layers.BaseLayer) (id, seq uint16) {
+	isEcho := (version == 4 && (typ == icmpV4EchoRequest || typ == icmpV4EchoReply)) ||
+		(version == 6 && (typ == icmpV6EchoRequest || typ == icmpV6EchoReply))
+	if !isEcho || len(base.Payload) < 4 {
+		return 0, 0
+	}
+	return binary.BigEndian.Uint16(base.Payload[0:2]), binary.BigEndian.Uint16(base.Payload[2:4])
+}
+
+// humanReadable returns a short, human friendly description of the message,
+// for the icmp.request.message/icmp.response.message fields.
+func humanReadable(tuple *icmpTuple, msg *icmpMessage) string {
+	if tuple.IcmpVersion == 4 {
+		switch msg.Type {
+		case icmpV4EchoRequest:
+			return "Echo Request"
+		case icmpV4EchoReply:
+			return "Echo Reply"
+		case 3:
+			return "Destination Unreachable"
+		case 5:
+			return "Redirect"
+		case 11:
+			return "Time Exceeded"
+		case 12:
+			return "Parameter Problem"
+		}
+	} else {
+		switch msg.Type {
+		case icmpV6EchoRequest:
+			return "Echo Request"
+		case icmpV6EchoReply:
+			return "Echo Reply"
+		case 1:
+			return "Destination Unreachable"
+		case 2:
+			return "Packet Too Big"
+		case 3:
+			return "Time Exceeded"
+		case 4:
+			return "Parameter Problem"
+		case 133:
+			return "Router Solicitation"
+		case 134:
+			return "Router Advertisement"
+		case 135:
+			return "Neighbor Solicitation"
+		case 136:
+			return "Neighbor Advertisement"
+		case 137:
+			return "Redirect"
+		}
+	}
+	return fmt.Sprintf("Type: %d, Code: %d", msg.Type, msg.Code)
+}